@@ -0,0 +1,47 @@
+package binutil
+
+import (
+	"io"
+	"os"
+)
+
+// Sizer is anything that can report, up front, how many bytes it will
+// serialize to -- used to lay out offsets before the bytes themselves are
+// produced. A value satisfying Sizer but not SizedReader (e.g. a plain
+// struct of fixed-size fields) is written out by walking its fields
+// instead of copying bytes from a Reader; see coff.Coff's use of Walk.
+type Sizer interface {
+	Size() int64
+}
+
+// SizedReader is anything that can report the number of bytes that will be
+// produced when read in full -- used so that the writer can copy its bytes
+// straight through, rather than walking it field by field.
+type SizedReader interface {
+	io.Reader
+	Sizer
+}
+
+// sizedFile is a SizedReader backed by an *os.File, closeable like one.
+type sizedFile struct {
+	*io.SectionReader
+	f *os.File
+}
+
+func (s *sizedFile) Close() error { return s.f.Close() }
+
+// SizedOpen opens fname for reading and wraps it in a SizedReader covering
+// the whole file, so that callers can stream the contents straight into the
+// output without buffering them in memory first.
+func SizedOpen(fname string) (*sizedFile, error) {
+	f, err := os.Open(fname)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &sizedFile{io.NewSectionReader(f, 0, fi.Size()), f}, nil
+}
@@ -0,0 +1,83 @@
+package binutil
+
+import (
+	"errors"
+	"reflect"
+)
+
+// WALK_SKIP can be returned from a Walk callback to tell Walk not to descend
+// into the value's children (useful once the callback has already consumed
+// the value itself, e.g. by streaming a SizedReader's bytes directly).
+var WALK_SKIP = errors.New("binutil: skip children")
+
+// Plain reports whether a reflect.Kind is a fixed-size value that can be
+// written out directly (via binary.Write-style encoding), as opposed to one
+// that Walk must recurse into (struct, slice, array, ptr).
+func Plain(kind reflect.Kind) bool {
+	switch kind {
+	case reflect.Bool,
+		reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
+
+// Walk visits v and, recursively, every field/element reachable from it,
+// calling fn at each step with the reflect.Value and a dotted path for
+// debugging. Structs are walked field by field, slices and arrays element
+// by element, and pointers are dereferenced transparently. fn may return
+// WALK_SKIP to stop Walk from descending into that value's children, or any
+// other non-nil error to abort the walk entirely.
+func Walk(i interface{}, fn func(v reflect.Value, path string) error) error {
+	return walk(reflect.ValueOf(i), "", fn)
+}
+
+func walk(v reflect.Value, path string, fn func(v reflect.Value, path string) error) error {
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return nil
+		}
+		return walk(v.Elem(), path, fn)
+	}
+
+	err := fn(v, path)
+	if err == WALK_SKIP {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	// An interface value's own Kind() is Interface regardless of what it
+	// holds, so unwrap it before deciding how (or whether) to recurse.
+	vv := v
+	for vv.Kind() == reflect.Interface || vv.Kind() == reflect.Ptr {
+		if vv.IsNil() {
+			return nil
+		}
+		vv = vv.Elem()
+	}
+
+	switch vv.Kind() {
+	case reflect.Struct:
+		t := vv.Type()
+		for i := 0; i < vv.NumField(); i++ {
+			if t.Field(i).PkgPath != "" {
+				continue // unexported field; reflect can't Interface() it
+			}
+			name := t.Field(i).Name
+			if err := walk(vv.Field(i), path+"."+name, fn); err != nil {
+				return err
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < vv.Len(); i++ {
+			if err := walk(vv.Index(i), path+"[]", fn); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
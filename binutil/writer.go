@@ -0,0 +1,31 @@
+package binutil
+
+import (
+	"encoding/binary"
+	"io"
+)
+
+// Writer is a small helper around an io.Writer that remembers the first
+// error it encounters, so callers can issue a sequence of writes and only
+// check Err once at the end.
+type Writer struct {
+	W   io.Writer
+	Err error
+}
+
+// WriteLE writes v in little-endian byte order (the byte order used
+// throughout PE/COFF files).
+func (w *Writer) WriteLE(v interface{}) {
+	if w.Err != nil {
+		return
+	}
+	w.Err = binary.Write(w.W, binary.LittleEndian, v)
+}
+
+// WriteFromSized copies all of r's bytes to the underlying writer.
+func (w *Writer) WriteFromSized(r SizedReader) {
+	if w.Err != nil {
+		return
+	}
+	_, w.Err = io.Copy(w.W, r)
+}
@@ -0,0 +1,330 @@
+// Package coff implements just enough of the COFF object file format to
+// build a .syso file holding a single .rsrc (or .rdata) section, suitable
+// for the Go linker to pick up and merge into a Win32 binary.
+package coff
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"reflect"
+
+	"github.com/SentrysAI/rsrc/binutil"
+)
+
+const (
+	fileHeaderSize    = 20
+	sectionHeaderSize = 40
+	relocationSize    = 10
+	symbolRecordSize  = 18
+)
+
+// FileHeader is IMAGE_FILE_HEADER.
+type FileHeader struct {
+	Machine              uint16
+	NumberOfSections     uint16
+	TimeDateStamp        uint32
+	PointerToSymbolTable uint32
+	NumberOfSymbols      uint32
+	SizeOfOptionalHeader uint16
+	Characteristics      uint16
+}
+
+// SectionHeader is IMAGE_SECTION_HEADER.
+type SectionHeader struct {
+	Name                 [8]byte
+	VirtualSize          uint32
+	VirtualAddress       uint32
+	SizeOfRawData        uint32
+	PointerToRawData     uint32
+	PointerToRelocations uint32
+	PointerToLineNumbers uint32
+	NumberOfRelocations  uint16
+	NumberOfLineNumbers  uint16
+	Characteristics      uint32
+}
+
+// RelocationEntry is IMAGE_RELOCATION.
+type RelocationEntry struct {
+	VirtualAddress   uint32
+	SymbolTableIndex uint32
+	Type             uint16
+}
+
+// SymbolTableRecord is IMAGE_SYMBOL.
+type SymbolTableRecord struct {
+	Name               [8]byte
+	Value              uint32
+	SectionNumber      int16
+	Type               uint16
+	StorageClass       uint8
+	NumberOfAuxSymbols uint8
+}
+
+// StringTable is the COFF string table: a 4-byte total-size prefix followed
+// by NUL-terminated strings, referenced from SymbolTableRecord.Name when a
+// name doesn't fit in 8 bytes.
+type StringTable struct {
+	Size int32
+	Data []byte
+}
+
+// Section bundles a section header with its raw contents and the
+// relocations that apply to it. Data is either a binutil.SizedReader (raw
+// bytes copied verbatim) or a struct to be serialized field-by-field, such
+// as a *ResourceDirectory.
+type Section struct {
+	SectionHeader
+	Relocations []RelocationEntry
+	Data        interface{}
+}
+
+// Coff is the in-memory representation of the COFF object being built. Its
+// field layout mirrors the order fields are written to the output file, so
+// write() can simply binutil.Walk the whole struct.
+type Coff struct {
+	FileHeader
+	Sections    []*Section
+	Symbols     []*SymbolTableRecord
+	StringTable StringTable
+
+	arch string
+}
+
+func sectionName(name string) (n [8]byte) {
+	copy(n[:], name)
+	return
+}
+
+// NewRSRC creates an empty Coff with a single, as yet unpopulated, .rsrc
+// section, ready to have resources added via AddResource/AddResourceEx.
+func NewRSRC() *Coff {
+	coff := &Coff{}
+	coff.Sections = []*Section{
+		{
+			SectionHeader: SectionHeader{
+				Name:            sectionName(".rsrc"),
+				Characteristics: IMAGE_SCN_CNT_INITIALIZED_DATA | IMAGE_SCN_MEM_READ | IMAGE_SCN_ALIGN_4BYTES,
+			},
+			Data: &ResourceDirectory{},
+		},
+	}
+	return coff
+}
+
+// NewRDATA creates an empty Coff with a single .rdata section, used by the
+// legacy -data flag to embed a raw blob addressable from Go assembly.
+func NewRDATA() *Coff {
+	coff := &Coff{}
+	coff.Sections = []*Section{
+		{
+			SectionHeader: SectionHeader{
+				Name:            sectionName(".rdata"),
+				Characteristics: IMAGE_SCN_CNT_INITIALIZED_DATA | IMAGE_SCN_MEM_READ | IMAGE_SCN_MEM_WRITE | IMAGE_SCN_ALIGN_4BYTES,
+			},
+			Data: &rdata{},
+		},
+	}
+	return coff
+}
+
+// Arch sets the target machine of the object file. Supported values are
+// "386", "amd64", "arm" and "arm64".
+func (coff *Coff) Arch(arch string) error {
+	switch arch {
+	case "386":
+		coff.Machine = IMAGE_FILE_MACHINE_I386
+	case "amd64":
+		coff.Machine = IMAGE_FILE_MACHINE_AMD64
+	case "arm":
+		coff.Machine = IMAGE_FILE_MACHINE_ARMNT
+	case "arm64":
+		coff.Machine = IMAGE_FILE_MACHINE_ARM64
+	default:
+		return fmt.Errorf(`coff: architecture "%s" not supported`, arch)
+	}
+	coff.arch = arch
+	return nil
+}
+
+// relocType returns the image-relative-address-without-base relocation
+// type appropriate for the object's target machine, i.e. the one used for
+// RT_GROUP_ICON/resource-directory pointers into this same section.
+func (coff *Coff) relocType() (uint16, error) {
+	switch coff.arch {
+	case "386":
+		return IMAGE_REL_I386_DIR32NB, nil
+	case "amd64":
+		return IMAGE_REL_AMD64_ADDR32NB, nil
+	case "arm":
+		return IMAGE_REL_ARM_ADDR32NB, nil
+	case "arm64":
+		return IMAGE_REL_ARM64_ADDR32NB, nil
+	default:
+		return 0, fmt.Errorf("coff: Arch must be set before adding resources")
+	}
+}
+
+// AddResource adds a numeric-ID resource of the given RT_* type, under the
+// default (English - United States) language, using id both as the
+// resource's name and, together with the type, to keep insertion order
+// stable across calls. It is a thin convenience wrapper around
+// AddResourceEx for the common manifest/icon case.
+func (coff *Coff) AddResource(kind, id uint16, r binutil.Sizer) {
+	coff.AddResourceEx(kind, ResourceID{Int: id}, LangDefault, r)
+}
+
+// AddData appends a named blob to a Coff created with NewRDATA. It is used
+// by the legacy -data flag and has nothing to do with the resource tree.
+func (coff *Coff) AddData(name string, r binutil.SizedReader) {
+	rd := coff.Sections[0].Data.(*rdata)
+	rd.entries = append(rd.entries, rdataEntry{name: name, data: r})
+}
+
+// addSymbol appends a symbol table record, spilling name into the string
+// table when it doesn't fit in the record's 8-byte inline Name field, and
+// returns the record's index.
+func (coff *Coff) addSymbol(name string, value uint32, sectionNumber int16, storageClass uint8) uint32 {
+	rec := &SymbolTableRecord{Value: value, SectionNumber: sectionNumber, StorageClass: storageClass}
+	if len(name) <= 8 {
+		copy(rec.Name[:], name)
+	} else {
+		if len(coff.StringTable.Data) == 0 {
+			coff.StringTable.Size = 4 // the size field counts itself
+		}
+		offset := uint32(coff.StringTable.Size)
+		coff.StringTable.Data = append(coff.StringTable.Data, append([]byte(name), 0)...)
+		coff.StringTable.Size += int32(len(name) + 1)
+		binary.LittleEndian.PutUint32(rec.Name[4:8], offset)
+	}
+	idx := uint32(len(coff.Symbols))
+	coff.Symbols = append(coff.Symbols, rec)
+	return idx
+}
+
+// totalSize returns the number of bytes a section's content occupies,
+// whatever shape its Data currently has.
+func totalSize(data interface{}) uint32 {
+	switch d := data.(type) {
+	case *ResourceDirectory:
+		return 0 // not yet built; callers freeze first
+	case *dirLevel:
+		sz := d.size()
+		for _, r := range d.RawData {
+			sz += uint32(r.(binutil.Sizer).Size())
+		}
+		return sz
+	case *rdata:
+		var sz int64
+		for _, b := range d.Blobs {
+			sz += b.Size()
+		}
+		return uint32(sz)
+	default:
+		return 0
+	}
+}
+
+// Freeze finalizes the object: it builds the physical resource tree (or
+// raw data blob), then computes every file offset -- section contents,
+// relocations, symbol table, string table -- and the relocations needed
+// so the linker fills in the right addresses. It must be called exactly
+// once, after all resources have been added.
+func (coff *Coff) Freeze() {
+	coff.NumberOfSections = uint16(len(coff.Sections))
+
+	for i, s := range coff.Sections {
+		switch data := s.Data.(type) {
+		case *ResourceDirectory:
+			relocType, err := coff.relocType()
+			if err != nil {
+				continue // Arch was never called; leave the section empty
+			}
+			root, relocs := data.freeze(relocType)
+			s.Data = root
+
+			symIdx := coff.addSymbol(string(s.Name[:]), 0, int16(i+1), IMAGE_SYM_CLASS_STATIC)
+			for j := range relocs {
+				relocs[j].SymbolTableIndex = symIdx
+			}
+			s.Relocations = relocs
+			s.NumberOfRelocations = uint16(len(s.Relocations))
+		case *rdata:
+			data.freeze()
+		}
+	}
+
+	cursor := uint32(fileHeaderSize + sectionHeaderSize*len(coff.Sections))
+	for _, s := range coff.Sections {
+		s.PointerToRawData = cursor
+		size := totalSize(s.Data)
+		s.SizeOfRawData = size
+		s.VirtualSize = size
+		cursor += size
+	}
+	for _, s := range coff.Sections {
+		if len(s.Relocations) == 0 {
+			continue
+		}
+		s.PointerToRelocations = cursor
+		cursor += relocationSize * uint32(len(s.Relocations))
+	}
+	coff.PointerToSymbolTable = cursor
+	coff.NumberOfSymbols = uint32(len(coff.Symbols))
+
+	if coff.StringTable.Size == 0 {
+		coff.StringTable.Size = 4 // the table is always present, even if empty
+	}
+}
+
+// WriteTo serializes the (already Frozen) object to w. It writes each
+// piece in the physical order Freeze laid file offsets out in -- headers,
+// then every section's raw data, then every section's relocations, then
+// the symbol table and string table -- which is not the same as Coff's Go
+// field order (Section groups a header with its relocations and data
+// together, since that's the natural way to build one up).
+func (coff *Coff) WriteTo(w io.Writer) error {
+	bw := binutil.Writer{W: w}
+
+	walkWrite(&bw, coff.FileHeader)
+	for _, s := range coff.Sections {
+		walkWrite(&bw, s.SectionHeader)
+	}
+	for _, s := range coff.Sections {
+		walkWrite(&bw, s.Data)
+	}
+	for _, s := range coff.Sections {
+		for _, reloc := range s.Relocations {
+			walkWrite(&bw, reloc)
+		}
+	}
+	for _, sym := range coff.Symbols {
+		walkWrite(&bw, sym)
+	}
+	walkWrite(&bw, coff.StringTable.Size)
+	bw.WriteFromSized(bytes.NewReader(coff.StringTable.Data))
+
+	if bw.Err != nil {
+		return fmt.Errorf("coff: error writing object: %s", bw.Err)
+	}
+	return nil
+}
+
+// walkWrite serializes v to bw: every Plain field is written in
+// little-endian order, every binutil.SizedReader is copied through
+// verbatim, and everything else (e.g. a GRPICONDIR) is recursed into field
+// by field.
+func walkWrite(bw *binutil.Writer, v interface{}) {
+	binutil.Walk(v, func(fv reflect.Value, path string) error {
+		if binutil.Plain(fv.Kind()) {
+			bw.WriteLE(fv.Interface())
+			return nil
+		}
+		if r, ok := fv.Interface().(binutil.SizedReader); ok {
+			bw.WriteFromSized(r)
+			return binutil.WALK_SKIP
+		}
+		return nil
+	})
+}
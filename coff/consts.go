@@ -0,0 +1,69 @@
+package coff
+
+// Resource types (RT_*), as used in the Type field of a resource directory
+// entry. Custom resource types outside this list can still be embedded by
+// passing their numeric ID directly to AddResourceEx.
+const (
+	RT_CURSOR       = 1
+	RT_BITMAP       = 2
+	RT_ICON         = 3
+	RT_MENU         = 4
+	RT_DIALOG       = 5
+	RT_STRING       = 6
+	RT_FONTDIR      = 7
+	RT_FONT         = 8
+	RT_ACCELERATOR  = 9
+	RT_RCDATA       = 10
+	RT_MESSAGETABLE = 11
+	RT_GROUP_CURSOR = 12
+	RT_GROUP_ICON   = 14
+	RT_VERSION      = 16
+	RT_DLGINCLUDE   = 17
+	RT_PLUGPLAY     = 19
+	RT_VXD          = 20
+	RT_ANICURSOR    = 21
+	RT_ANIICON      = 22
+	RT_HTML         = 23
+	RT_MANIFEST     = 24
+)
+
+// IMAGE_FILE_MACHINE_* values, used in FileHeader.Machine to identify the
+// target architecture of the object file.
+const (
+	IMAGE_FILE_MACHINE_I386  = 0x014C
+	IMAGE_FILE_MACHINE_AMD64 = 0x8664
+	IMAGE_FILE_MACHINE_ARMNT = 0x01C4
+	IMAGE_FILE_MACHINE_ARM64 = 0xAA64
+)
+
+// IMAGE_REL_* relocation types. Which ones are valid depends on the target
+// machine: the I386/AMD64 pairs below apply to x86 objects, ARM/ARM64 ones
+// to ARM objects.
+const (
+	IMAGE_REL_I386_DIR32NB = 0x0007
+
+	IMAGE_REL_AMD64_ADDR32NB = 0x0003
+
+	IMAGE_REL_ARM_ADDR32NB = 0x0002
+
+	IMAGE_REL_ARM64_ADDR32NB = 0x0002
+)
+
+// Section characteristics flags used for the .rsrc/.rdata sections we emit.
+const (
+	IMAGE_SCN_CNT_INITIALIZED_DATA = 0x00000040
+	IMAGE_SCN_MEM_READ             = 0x40000000
+	IMAGE_SCN_MEM_WRITE            = 0x80000000
+	IMAGE_SCN_ALIGN_4BYTES         = 0x00300000
+)
+
+// IMAGE_SYM_* constants used in the symbol table.
+const (
+	IMAGE_SYM_CLASS_EXTERNAL = 2
+	IMAGE_SYM_CLASS_STATIC   = 3
+	IMAGE_SYM_TYPE_NULL      = 0
+	IMAGE_SYM_DTYPE_NULL     = 0
+	IMAGE_SYM_UNDEFINED      = 0
+	IMAGE_SYM_ABSOLUTE       = -1
+	IMAGE_SYM_DEBUG          = -2
+)
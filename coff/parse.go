@@ -0,0 +1,246 @@
+package coff
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/SentrysAI/rsrc/binutil"
+)
+
+// Parse reads back an existing COFF object (as produced by NewRSRC,
+// AddResource(Ex) and WriteTo) and reconstructs its section headers and,
+// for any .rsrc section, its resource tree, so tools can inspect resources
+// that were written by a previous run rather than only ever writing new
+// ones. Sections other than .rsrc are returned with their raw bytes in
+// Section.Data as a *bytes.Reader.
+func Parse(r io.ReaderAt) (*Coff, error) {
+	var fh FileHeader
+	if err := readAt(r, 0, &fh); err != nil {
+		return nil, fmt.Errorf("coff: error reading file header: %s", err)
+	}
+
+	c := &Coff{FileHeader: fh}
+	offset := int64(fileHeaderSize)
+	for i := 0; i < int(fh.NumberOfSections); i++ {
+		var sh SectionHeader
+		if err := readAt(r, offset, &sh); err != nil {
+			return nil, fmt.Errorf("coff: error reading section header #%d: %s", i, err)
+		}
+		offset += sectionHeaderSize
+
+		raw := make([]byte, sh.SizeOfRawData)
+		if sh.SizeOfRawData > 0 {
+			if _, err := r.ReadAt(raw, int64(sh.PointerToRawData)); err != nil {
+				return nil, fmt.Errorf("coff: error reading section #%d data: %s", i, err)
+			}
+		}
+
+		sec := &Section{SectionHeader: sh}
+		if strings.TrimRight(string(sh.Name[:]), "\x00") == ".rsrc" {
+			tree, err := parseResourceDirectory(raw)
+			if err != nil {
+				return nil, fmt.Errorf("coff: error parsing .rsrc section: %s", err)
+			}
+			sec.Data = tree
+		} else {
+			sec.Data = bytes.NewReader(raw)
+		}
+		c.Sections = append(c.Sections, sec)
+	}
+	return c, nil
+}
+
+// readAt decodes binary.Size(v) little-endian bytes read from r at off into v.
+func readAt(r io.ReaderAt, off int64, v interface{}) error {
+	buf := make([]byte, binary.Size(v))
+	if _, err := r.ReadAt(buf, off); err != nil {
+		return err
+	}
+	return binary.Read(bytes.NewReader(buf), binary.LittleEndian, v)
+}
+
+// dirEntryRef is one IMAGE_RESOURCE_DIRECTORY_ENTRY, resolved to a usable
+// ResourceID and with its high-bit flags split out.
+type dirEntryRef struct {
+	id     ResourceID
+	target uint32
+	isDir  bool
+}
+
+// readDirEntries reads the IMAGE_RESOURCE_DIRECTORY at offset within raw,
+// along with the directory entries that follow it.
+func readDirEntries(raw []byte, offset uint32) ([]dirEntryRef, error) {
+	if uint64(offset)+16 > uint64(len(raw)) {
+		return nil, fmt.Errorf("directory at offset %d out of range", offset)
+	}
+	var hdr ImageResourceDirectory
+	if err := binary.Read(bytes.NewReader(raw[offset:offset+16]), binary.LittleEndian, &hdr); err != nil {
+		return nil, err
+	}
+
+	n := int(hdr.NumberOfNamedEntries) + int(hdr.NumberOfIdEntries)
+	base := offset + 16
+	entries := make([]dirEntryRef, n)
+	for i := 0; i < n; i++ {
+		off := base + uint32(i*8)
+		if uint64(off)+8 > uint64(len(raw)) {
+			return nil, fmt.Errorf("directory entry at offset %d out of range", off)
+		}
+		var e ImageResourceDirectoryEntry
+		if err := binary.Read(bytes.NewReader(raw[off:off+8]), binary.LittleEndian, &e); err != nil {
+			return nil, err
+		}
+
+		id := ResourceID{Int: uint16(e.Name)}
+		if e.Name&0x80000000 != 0 {
+			s, err := readResourceString(raw, e.Name&^0x80000000)
+			if err != nil {
+				return nil, err
+			}
+			id = ResourceID{Str: s}
+		}
+		entries[i] = dirEntryRef{
+			id:     id,
+			target: e.OffsetToData &^ 0x80000000,
+			isDir:  e.OffsetToData&0x80000000 != 0,
+		}
+	}
+	return entries, nil
+}
+
+// readResourceString decodes the IMAGE_RESOURCE_DIRECTORY_STRING_U at
+// offset within raw.
+func readResourceString(raw []byte, offset uint32) (string, error) {
+	if uint64(offset)+2 > uint64(len(raw)) {
+		return "", fmt.Errorf("resource string at offset %d out of range", offset)
+	}
+	length := binary.LittleEndian.Uint16(raw[offset : offset+2])
+	start := offset + 2
+	end := uint64(start) + 2*uint64(length)
+	if end > uint64(len(raw)) {
+		return "", fmt.Errorf("resource string at offset %d out of range", offset)
+	}
+
+	chars := make([]uint16, length)
+	for i := range chars {
+		chars[i] = binary.LittleEndian.Uint16(raw[start+uint32(i)*2 : start+uint32(i)*2+2])
+	}
+	return string(utf16.Decode(chars)), nil
+}
+
+// parseResourceDirectory walks the Type/Name/Language directory tree
+// stored in raw (a .rsrc section's raw bytes) and rebuilds it as a logical
+// ResourceDirectory, the same shape AddResourceEx builds up, so that
+// Coff.Resources can flatten it for callers.
+func parseResourceDirectory(raw []byte) (*ResourceDirectory, error) {
+	if len(raw) == 0 {
+		return &ResourceDirectory{}, nil
+	}
+
+	typeRefs, err := readDirEntries(raw, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	tree := &ResourceDirectory{}
+	for _, tr := range typeRefs {
+		if !tr.isDir {
+			return nil, fmt.Errorf("malformed resource tree: type-level entry is not a subdirectory")
+		}
+		nameRefs, err := readDirEntries(raw, tr.target)
+		if err != nil {
+			return nil, err
+		}
+
+		lt := logicalType{id: tr.id}
+		for _, nr := range nameRefs {
+			if !nr.isDir {
+				return nil, fmt.Errorf("malformed resource tree: name-level entry is not a subdirectory")
+			}
+			langRefs, err := readDirEntries(raw, nr.target)
+			if err != nil {
+				return nil, err
+			}
+
+			ln := logicalName{id: nr.id}
+			for _, lr := range langRefs {
+				if lr.isDir {
+					return nil, fmt.Errorf("malformed resource tree: language-level entry is a subdirectory")
+				}
+				if uint64(lr.target)+16 > uint64(len(raw)) {
+					return nil, fmt.Errorf("data entry at offset %d out of range", lr.target)
+				}
+				var de ImageResourceDataEntry
+				if err := binary.Read(bytes.NewReader(raw[lr.target:lr.target+16]), binary.LittleEndian, &de); err != nil {
+					return nil, err
+				}
+				if uint64(de.DataRVA)+uint64(de.Size) > uint64(len(raw)) {
+					return nil, fmt.Errorf("resource data at offset %d out of range", de.DataRVA)
+				}
+				data := raw[de.DataRVA : de.DataRVA+de.Size]
+				ln.langs = append(ln.langs, logicalLang{id: lr.id, data: bytes.NewReader(data)})
+			}
+			lt.names = append(lt.names, ln)
+		}
+		tree.types = append(tree.types, lt)
+	}
+	return tree, nil
+}
+
+// Resource is one flattened Type/Name/Language leaf of a resource tree
+// reconstructed by Parse.
+type Resource struct {
+	Type ResourceID
+	Name ResourceID
+	Lang ResourceID
+	Data []byte
+}
+
+// Resources flattens a resource tree into a list of leaves, reading each
+// one's data in full. It works both on a Coff returned by Parse and on one
+// still being built via AddResource/AddResourceEx (as long as Freeze
+// hasn't replaced its logical tree with a physical one yet); a leaf whose
+// data is a plain struct such as a GRPICONDIR rather than an io.Reader is
+// serialized the same way WriteTo would.
+func (coff *Coff) Resources() ([]Resource, error) {
+	tree, err := coff.rsrcTree()
+	if err != nil {
+		return nil, err
+	}
+
+	var out []Resource
+	for _, t := range tree.types {
+		for _, n := range t.names {
+			for _, l := range n.langs {
+				data, err := readAllSizer(l.data)
+				if err != nil {
+					return nil, fmt.Errorf("coff: error reading resource data: %s", err)
+				}
+				out = append(out, Resource{Type: t.id, Name: n.id, Lang: l.id, Data: data})
+			}
+		}
+	}
+	return out, nil
+}
+
+func readAllSizer(s binutil.Sizer) ([]byte, error) {
+	if r, ok := s.(io.Reader); ok {
+		buf := make([]byte, s.Size())
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		return buf, nil
+	}
+
+	var buf bytes.Buffer
+	bw := binutil.Writer{W: &buf}
+	walkWrite(&bw, s)
+	if bw.Err != nil {
+		return nil, bw.Err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,23 @@
+package coff
+
+import "github.com/SentrysAI/rsrc/binutil"
+
+// rdataEntry is one named blob embedded in a .rdata section, addressed by
+// the Go assembly symbols _b<name>/_e<name> generated in rsrc.go.
+type rdataEntry struct {
+	name string
+	data binutil.SizedReader
+}
+
+// rdata is the legacy, pre-go:embed -data mode: it just concatenates raw
+// blobs one after another, with no resource directory at all.
+type rdata struct {
+	entries []rdataEntry
+	Blobs   []binutil.SizedReader
+}
+
+func (r *rdata) freeze() {
+	for _, e := range r.entries {
+		r.Blobs = append(r.Blobs, e.data)
+	}
+}
@@ -0,0 +1,97 @@
+package coff
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"unicode/utf16"
+
+	"github.com/SentrysAI/rsrc/binutil"
+)
+
+// res32BitHeader is the fixed 32-byte entry every Microsoft .res file
+// begins with: a zero-length, zero-ID resource whose presence marks the
+// file as the modern (32-bit) resource format rather than the legacy
+// 16-bit one.
+var res32BitHeader = []byte{
+	0x00, 0x00, 0x00, 0x00, // DataSize
+	0x20, 0x00, 0x00, 0x00, // HeaderSize
+	0xFF, 0xFF, 0x00, 0x00, // Type: ordinal 0
+	0xFF, 0xFF, 0x00, 0x00, // Name: ordinal 0
+	0x00, 0x00, 0x00, 0x00, // DataVersion
+	0x00, 0x00, // MemoryFlags
+	0x00, 0x00, // LanguageId
+	0x00, 0x00, 0x00, 0x00, // Version
+	0x00, 0x00, 0x00, 0x00, // Characteristics
+}
+
+// WriteRes writes coff's resource tree out in the legacy Microsoft .res
+// format -- the flat list of type/name/language entries produced by
+// rc.exe and consumed by link.exe, windres and similar non-Go toolchains
+// -- instead of wrapping it in a COFF object. Unlike WriteSyso, .res needs
+// no section layout or relocations, so this may be called whether or not
+// Freeze has been called.
+func (coff *Coff) WriteRes(w io.Writer) error {
+	resources, err := coff.Resources()
+	if err != nil {
+		return fmt.Errorf("coff: error reading resource tree: %s", err)
+	}
+
+	bw := binutil.Writer{W: w}
+	bw.WriteFromSized(bytes.NewReader(res32BitHeader))
+	for _, res := range resources {
+		writeResEntry(&bw, res)
+	}
+
+	if bw.Err != nil {
+		return fmt.Errorf("coff: error writing .res object: %s", bw.Err)
+	}
+	return nil
+}
+
+// writeResEntry writes one .res resource entry: a header (DataSize,
+// HeaderSize, Type, Name, DataVersion, MemoryFlags, LanguageId, Version,
+// Characteristics) followed by the resource's data, padded to a 4-byte
+// boundary.
+func writeResEntry(bw *binutil.Writer, res Resource) {
+	typeField := resIDField(res.Type)
+	nameField := resIDField(res.Name)
+	headerSize := 8 + len(typeField) + len(nameField) + 16
+
+	bw.WriteLE(uint32(len(res.Data)))
+	bw.WriteLE(uint32(headerSize))
+	bw.WriteFromSized(bytes.NewReader(typeField))
+	bw.WriteFromSized(bytes.NewReader(nameField))
+	bw.WriteLE(uint32(0))    // DataVersion
+	bw.WriteLE(uint16(0x30)) // MemoryFlags: MOVEABLE | PURE, same as rc.exe emits
+	bw.WriteLE(res.Lang.Int)
+	bw.WriteLE(uint32(0)) // Version
+	bw.WriteLE(uint32(0)) // Characteristics
+	bw.WriteFromSized(bytes.NewReader(res.Data))
+	if pad := -len(res.Data) & 3; pad > 0 {
+		bw.WriteFromSized(bytes.NewReader(make([]byte, pad)))
+	}
+}
+
+// resIDField encodes a ResourceID the way a .res entry header does: a
+// numeric ID as 0xFFFF followed by the ordinal, or a name as a
+// NUL-terminated UTF-16 string; either way padded to a 4-byte boundary.
+func resIDField(id ResourceID) []byte {
+	var buf []byte
+	if id.named() {
+		u := utf16.Encode([]rune(id.Str))
+		buf = make([]byte, 2*(len(u)+1)) // +1 leaves room for the NUL terminator
+		for i, c := range u {
+			binary.LittleEndian.PutUint16(buf[i*2:], c)
+		}
+	} else {
+		buf = make([]byte, 4)
+		binary.LittleEndian.PutUint16(buf[0:2], 0xFFFF)
+		binary.LittleEndian.PutUint16(buf[2:4], id.Int)
+	}
+	if pad := -len(buf) & 3; pad > 0 {
+		buf = append(buf, make([]byte, pad)...)
+	}
+	return buf
+}
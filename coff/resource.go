@@ -0,0 +1,331 @@
+package coff
+
+import (
+	"fmt"
+	"sort"
+	"unicode/utf16"
+
+	"github.com/SentrysAI/rsrc/binutil"
+)
+
+// LangDefault is the language ID rsrc uses when the caller doesn't care
+// about localization: English (United States).
+const LangDefault = 0x0409
+
+// ResourceID identifies a resource at one level of the Type/Name/Language
+// tree. A zero Str means the entry is addressed by Int (the common case);
+// a non-empty Str means it's addressed by name instead.
+type ResourceID struct {
+	Int uint16
+	Str string
+}
+
+func (id ResourceID) named() bool { return id.Str != "" }
+
+// ImageResourceDirectory is IMAGE_RESOURCE_DIRECTORY.
+type ImageResourceDirectory struct {
+	Characteristics      uint32
+	TimeDateStamp        uint32
+	MajorVersion         uint16
+	MinorVersion         uint16
+	NumberOfNamedEntries uint16
+	NumberOfIdEntries    uint16
+}
+
+// ImageResourceDirectoryEntry is IMAGE_RESOURCE_DIRECTORY_ENTRY.
+type ImageResourceDirectoryEntry struct {
+	Name         uint32
+	OffsetToData uint32
+}
+
+// ImageResourceDataEntry is IMAGE_RESOURCE_DATA_ENTRY.
+type ImageResourceDataEntry struct {
+	DataRVA  uint32
+	Size     uint32
+	Codepage uint32
+	Reserved uint32
+}
+
+// resourceString is an IMAGE_RESOURCE_DIRECTORY_STRING_U: a 16-bit length
+// (in UTF-16 code units) followed by the code units themselves, with no
+// NUL terminator.
+type resourceString struct {
+	Length uint16
+	Chars  []uint16
+}
+
+func newResourceString(s string) resourceString {
+	u := utf16.Encode([]rune(s))
+	return resourceString{Length: uint16(len(u)), Chars: u}
+}
+
+func (s resourceString) size() uint32 { return 2 + 2*uint32(len(s.Chars)) }
+
+// logical tree built up by AddResourceEx; Freeze turns this into the
+// physical ResourceDirectory below.
+type logicalLang struct {
+	id   ResourceID
+	data binutil.Sizer
+}
+
+type logicalName struct {
+	id    ResourceID
+	langs []logicalLang
+}
+
+type logicalType struct {
+	id    ResourceID
+	names []logicalName
+}
+
+// ResourceDirectory is the logical tree being assembled by
+// AddResource/AddResourceEx. Freeze converts it, level by level, into
+// physical dirLevel nodes ready to be written out.
+type ResourceDirectory struct {
+	types []logicalType
+}
+
+// dirLevel is one IMAGE_RESOURCE_DIRECTORY together with its entries, laid
+// out contiguously as the format requires. Exactly one of Children and
+// DataEntries is populated, depending on whether this level's entries
+// point at subdirectories (Type, Name) or at resource data (Language).
+type dirLevel struct {
+	ImageResourceDirectory
+	DirEntries  []ImageResourceDirectoryEntry
+	Strings     []resourceString
+	Children    []*dirLevel
+	DataEntries []ImageResourceDataEntry
+
+	// RawData holds each leaf's resource payload, in on-disk order: either
+	// a binutil.SizedReader (copied through verbatim) or a plain struct
+	// whose fields Walk serializes directly, such as a GRPICONDIR. It is
+	// only ever non-empty on the root dirLevel: the whole directory tree
+	// is written first, and the data it points to (via DataRVA) follows
+	// immediately after.
+	RawData []interface{}
+}
+
+// rsrcTree returns the logical resource tree for coff, which must have been
+// built by NewRSRC (whose single section always holds a *ResourceDirectory).
+// It errors rather than panics so that callers reached via Parse, which can
+// hand back a Coff with zero sections (e.g. a stripped object, or our own
+// .res output's leading null-resource header), fail cleanly instead of
+// indexing Sections[0] out of range.
+func (coff *Coff) rsrcTree() (*ResourceDirectory, error) {
+	if len(coff.Sections) == 0 {
+		return nil, fmt.Errorf("coff: no sections in object")
+	}
+	tree, ok := coff.Sections[0].Data.(*ResourceDirectory)
+	if !ok {
+		return nil, fmt.Errorf("coff: first section is not a .rsrc resource directory")
+	}
+	return tree, nil
+}
+
+// AddResourceEx adds a resource anywhere in the Type/Name/Language tree,
+// creating any intermediate directory levels that don't exist yet. name
+// may be a uint16 numeric ID, a plain int, a string, or a ResourceID; r
+// supplies the resource's raw bytes, streamed rather than buffered.
+func (coff *Coff) AddResourceEx(typeID uint16, name interface{}, lang uint16, r binutil.Sizer) {
+	tree, err := coff.rsrcTree()
+	if err != nil {
+		// Only ever called on a Coff built by NewRSRC, which always has a
+		// .rsrc section in place; a missing section here is a bug in this
+		// package, not bad input.
+		panic(err)
+	}
+	typeKey := ResourceID{Int: typeID}
+	nameKey := toResourceID(name)
+	langKey := ResourceID{Int: lang}
+
+	var t *logicalType
+	for i := range tree.types {
+		if tree.types[i].id == typeKey {
+			t = &tree.types[i]
+			break
+		}
+	}
+	if t == nil {
+		tree.types = append(tree.types, logicalType{id: typeKey})
+		t = &tree.types[len(tree.types)-1]
+	}
+
+	var n *logicalName
+	for i := range t.names {
+		if t.names[i].id == nameKey {
+			n = &t.names[i]
+			break
+		}
+	}
+	if n == nil {
+		t.names = append(t.names, logicalName{id: nameKey})
+		n = &t.names[len(t.names)-1]
+	}
+
+	n.langs = append(n.langs, logicalLang{id: langKey, data: r})
+}
+
+// toResourceID converts the name argument accepted by AddResourceEx into a
+// ResourceID, panicking on any other type since that's a programmer error.
+func toResourceID(name interface{}) ResourceID {
+	switch v := name.(type) {
+	case ResourceID:
+		return v
+	case uint16:
+		return ResourceID{Int: v}
+	case int:
+		return ResourceID{Int: uint16(v)}
+	case string:
+		return ResourceID{Str: v}
+	default:
+		panic("coff: resource name must be a uint16, int or string")
+	}
+}
+
+// idList describes one directory level's worth of sibling entries in a
+// form newDirLevel can consume uniformly, whether the children are
+// subdirectories or raw resource data.
+type idEntry struct {
+	id    ResourceID
+	child *dirLevel
+	data  binutil.Sizer
+}
+
+// idLess reports whether a sorts before b under the ordering
+// IMAGE_RESOURCE_DIRECTORY requires at every level: named entries first
+// (sorted by name), then ID entries (sorted by ascending ID).
+func idLess(a, b ResourceID) bool {
+	if a.named() != b.named() {
+		return a.named()
+	}
+	if a.named() {
+		return a.Str < b.Str
+	}
+	return a.Int < b.Int
+}
+
+// newDirLevel builds a dirLevel from entries, ordering them by idLess. It
+// collects the raw data blocks (in final, on-disk order) into *raw.
+func newDirLevel(entries []idEntry, raw *[]interface{}) *dirLevel {
+	sort.SliceStable(entries, func(i, j int) bool {
+		return idLess(entries[i].id, entries[j].id)
+	})
+
+	d := &dirLevel{}
+	for _, e := range entries {
+		entry := ImageResourceDirectoryEntry{Name: uint32(e.id.Int)}
+		if e.id.named() {
+			d.Strings = append(d.Strings, newResourceString(e.id.Str))
+			d.NumberOfNamedEntries++
+		} else {
+			d.NumberOfIdEntries++
+		}
+		d.DirEntries = append(d.DirEntries, entry)
+
+		if e.child != nil {
+			d.Children = append(d.Children, e.child)
+		} else {
+			d.DataEntries = append(d.DataEntries, ImageResourceDataEntry{Size: uint32(e.data.Size())})
+			*raw = append(*raw, e.data)
+		}
+	}
+	return d
+}
+
+// build turns the logical Type/Name/Language tree into the physical
+// dirLevel tree, and returns the raw resource data blocks in the order
+// they'll be appended after that tree. Types and names are walked in the
+// same idLess order newDirLevel will later impose on their DirEntries, so
+// that raw's append order lines up with the DataRVA offsets layout()
+// assigns by walking the (sorted) physical tree; descending types/names in
+// logical insertion order instead would desync the two.
+func (tree *ResourceDirectory) build() (root *dirLevel, raw []interface{}) {
+	types := append([]logicalType(nil), tree.types...)
+	sort.SliceStable(types, func(i, j int) bool { return idLess(types[i].id, types[j].id) })
+
+	var typeEntries []idEntry
+	for _, t := range types {
+		names := append([]logicalName(nil), t.names...)
+		sort.SliceStable(names, func(i, j int) bool { return idLess(names[i].id, names[j].id) })
+
+		var nameEntries []idEntry
+		for _, n := range names {
+			var langs []idEntry
+			for _, l := range n.langs {
+				langs = append(langs, idEntry{id: l.id, data: l.data})
+			}
+			nameEntries = append(nameEntries, idEntry{id: n.id, child: newDirLevel(langs, &raw)})
+		}
+		typeEntries = append(typeEntries, idEntry{id: t.id, child: newDirLevel(nameEntries, &raw)})
+	}
+	root = newDirLevel(typeEntries, &raw)
+	return root, raw
+}
+
+// size returns the number of bytes d and everything nested under it
+// occupies, not counting the raw resource data the leaves point to (that's
+// appended separately, after the whole tree).
+func (d *dirLevel) size() uint32 {
+	sz := uint32(16 + 8*len(d.DirEntries) + 16*len(d.DataEntries))
+	for _, s := range d.Strings {
+		sz += s.size()
+	}
+	for _, c := range d.Children {
+		sz += c.size()
+	}
+	return sz
+}
+
+// layout assigns section-relative offsets to every header, entry, string
+// and data entry reachable from d (which starts at offset within the
+// .rsrc section), and to the raw data blocks that follow the whole tree
+// (tracked via rawOffset). It returns the relocations the DataRVA fields
+// need; SymbolTableIndex is left at 0 for Coff.Freeze to fill in once the
+// section's own symbol-table index is known.
+func layout(d *dirLevel, offset uint32, rawOffset *uint32, relocType uint16) []RelocationEntry {
+	var relocs []RelocationEntry
+
+	stringsOff := offset + 16 + 8*uint32(len(d.DirEntries))
+	cursor := stringsOff
+	for _, s := range d.Strings {
+		cursor += s.size()
+	}
+
+	strCursor := stringsOff
+	namedCount := 0
+	for i := range d.DirEntries {
+		if namedCount < len(d.Strings) && i < int(d.NumberOfNamedEntries) {
+			d.DirEntries[i].Name = 0x80000000 | strCursor
+			strCursor += d.Strings[namedCount].size()
+			namedCount++
+		}
+
+		if len(d.Children) > 0 {
+			child := d.Children[i]
+			d.DirEntries[i].OffsetToData = 0x80000000 | cursor
+			relocs = append(relocs, layout(child, cursor, rawOffset, relocType)...)
+			cursor += child.size()
+		} else {
+			d.DirEntries[i].OffsetToData = cursor
+			d.DataEntries[i].DataRVA = *rawOffset
+			relocs = append(relocs, RelocationEntry{
+				VirtualAddress: cursor, // offset of this IMAGE_RESOURCE_DATA_ENTRY's DataRVA field
+				Type:           relocType,
+			})
+			*rawOffset += d.DataEntries[i].Size
+			cursor += 16
+		}
+	}
+	return relocs
+}
+
+// freeze builds the physical tree from tree's logical entries, lays it
+// out, and replaces Section.Data with the result so the Coff's write pass
+// can serialize it directly.
+func (tree *ResourceDirectory) freeze(relocType uint16) (*dirLevel, []RelocationEntry) {
+	root, raw := tree.build()
+	rawOffset := root.size()
+	relocs := layout(root, 0, &rawOffset, relocType)
+	root.RawData = raw
+	return root, relocs
+}
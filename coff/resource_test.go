@@ -0,0 +1,48 @@
+package coff
+
+import (
+	"bytes"
+	"testing"
+)
+
+// TestAddResourceExOrdersNameEntries reproduces IDs added out of order via
+// AddResourceEx (as -spec/a JSON resource tree can do) and checks that the
+// frozen directory level still lists them in ascending ID order, as
+// IMAGE_RESOURCE_DIRECTORY requires for any caller that walks/binary-searches
+// assuming sorted entries.
+func TestAddResourceExOrdersNameEntries(t *testing.T) {
+	c := NewRSRC()
+	if err := c.Arch("amd64"); err != nil {
+		t.Fatalf("Arch: %s", err)
+	}
+
+	for _, id := range []uint16{5, 2, 9} {
+		c.AddResourceEx(RT_RCDATA, id, LangDefault, bytes.NewReader([]byte{0}))
+	}
+
+	relocType, err := c.relocType()
+	if err != nil {
+		t.Fatalf("relocType: %s", err)
+	}
+	tree := c.Sections[0].Data.(*ResourceDirectory)
+	root, _ := tree.freeze(relocType)
+
+	if len(root.Children) != 1 {
+		t.Fatalf("got %d type-level children, want 1", len(root.Children))
+	}
+	nameLevel := root.Children[0]
+
+	var got []uint32
+	for _, e := range nameLevel.DirEntries {
+		got = append(got, e.Name)
+	}
+	want := []uint32{2, 5, 9}
+	if len(got) != len(want) {
+		t.Fatalf("DirEntries = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("DirEntries = %v, want %v", got, want)
+		}
+	}
+}
@@ -0,0 +1,53 @@
+// Package ico decodes the headers of Windows .ico files -- just enough to
+// locate each embedded image and describe it in a RT_GROUP_ICON resource,
+// without decoding the image pixels themselves.
+package ico
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// ICONDIR is the fixed header at the start of an .ico file.
+type ICONDIR struct {
+	Reserved uint16 // must be 0
+	Type     uint16 // 1 for icons
+	Count    uint16 // number of images that follow
+}
+
+// IconDirEntryCommon is the part of an ICONDIRENTRY that also gets copied,
+// as-is, into the RT_GROUP_ICON resource's GRPICONDIRENTRY.
+type IconDirEntryCommon struct {
+	Width, Height, ColorCount, Reserved uint8
+	Planes, BitCount                    uint16
+}
+
+// IconDirEntry is one ICONDIRENTRY record: it describes a single image
+// stored in the .ico file.
+type IconDirEntry struct {
+	IconDirEntryCommon
+	BytesInRes  uint32
+	ImageOffset uint32
+}
+
+// DecodeHeaders reads an .ico file's ICONDIR and ICONDIRENTRY records from r
+// and returns the entries, without reading the image data itself (callers
+// are expected to seek/read it separately using ImageOffset/BytesInRes).
+func DecodeHeaders(r io.Reader) ([]IconDirEntry, error) {
+	var dir ICONDIR
+	if err := binary.Read(r, binary.LittleEndian, &dir); err != nil {
+		return nil, fmt.Errorf("ico: error reading ICONDIR: %s", err)
+	}
+	if dir.Reserved != 0 || dir.Type != 1 {
+		return nil, fmt.Errorf("ico: not a valid .ico file (bad ICONDIR header)")
+	}
+
+	entries := make([]IconDirEntry, dir.Count)
+	for i := range entries {
+		if err := binary.Read(r, binary.LittleEndian, &entries[i]); err != nil {
+			return nil, fmt.Errorf("ico: error reading ICONDIRENTRY #%d: %s", i, err)
+		}
+	}
+	return entries, nil
+}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"unicode/utf16"
+
+	"github.com/SentrysAI/rsrc/coff"
+	"github.com/SentrysAI/rsrc/ico"
+	"github.com/SentrysAI/rsrc/pkg/rsrc"
+)
+
+// isKnownMachine reports whether m is one of the FileHeader.Machine values
+// rsrc itself ever writes, used to reject non-COFF input (such as our own
+// .res output, whose 8 leading zero bytes parse as a FileHeader with
+// Machine 0) before -inspect tries to walk it as a resource tree.
+func isKnownMachine(m uint16) bool {
+	switch m {
+	case coff.IMAGE_FILE_MACHINE_I386, coff.IMAGE_FILE_MACHINE_AMD64,
+		coff.IMAGE_FILE_MACHINE_ARMNT, coff.IMAGE_FILE_MACHINE_ARM64:
+		return true
+	default:
+		return false
+	}
+}
+
+// rtName returns the "RT_*" name for a well-known resource type ID, or its
+// bare numeric value for custom types.
+func rtName(id uint16) string {
+	for name, rt := range rtByName {
+		if rt == id {
+			return name
+		}
+	}
+	return fmt.Sprintf("%d", id)
+}
+
+// runInspect implements -inspect: it parses an existing .syso/.res-style
+// COFF object and prints its resource tree, with decoded summaries for the
+// resource types rsrc itself knows how to produce.
+func runInspect(fnamein string) error {
+	f, err := os.Open(fnamein)
+	if err != nil {
+		return fmt.Errorf("Error opening '%s': %s", fnamein, err)
+	}
+	defer f.Close()
+
+	obj, err := coff.Parse(f)
+	if err != nil {
+		return fmt.Errorf("Error parsing '%s': %s", fnamein, err)
+	}
+	if !isKnownMachine(obj.Machine) {
+		return fmt.Errorf("'%s' doesn't look like a COFF object rsrc produced (unrecognized Machine 0x%04X); -inspect only understands .syso files, not .res", fnamein, obj.Machine)
+	}
+
+	fmt.Printf("Machine: 0x%04X, %d section(s)\n", obj.Machine, obj.NumberOfSections)
+
+	resources, err := obj.Resources()
+	if err != nil {
+		return fmt.Errorf("Error reading resources from '%s': %s", fnamein, err)
+	}
+	if len(resources) == 0 {
+		fmt.Println("(no .rsrc section, or it is empty)")
+		return nil
+	}
+
+	for _, res := range resources {
+		fmt.Printf("%s / %s / lang 0x%04X (%d bytes)\n",
+			resourceIDString(res.Type, rtName), resourceIDString(res.Name, nil), res.Lang.Int, len(res.Data))
+
+		switch res.Type.Int {
+		case coff.RT_MANIFEST:
+			printManifestSummary(res.Data)
+		case coff.RT_VERSION:
+			printVersionSummary(res.Data)
+		case coff.RT_GROUP_ICON:
+			printGroupIconSummary(res.Data)
+		}
+	}
+	return nil
+}
+
+// resourceIDString formats a ResourceID, applying nameFn (if non-nil) to a
+// numeric ID to render it as a known symbolic name.
+func resourceIDString(id coff.ResourceID, nameFn func(uint16) string) string {
+	if id.Str != "" {
+		return fmt.Sprintf("%q", id.Str)
+	}
+	if nameFn != nil {
+		return fmt.Sprintf("%s (%d)", nameFn(id.Int), id.Int)
+	}
+	return fmt.Sprintf("%d", id.Int)
+}
+
+func printManifestSummary(data []byte) {
+	const maxPreview = 200
+	preview := data
+	truncated := false
+	if len(preview) > maxPreview {
+		preview = preview[:maxPreview]
+		truncated = true
+	}
+	fmt.Printf("  manifest: %s", preview)
+	if truncated {
+		fmt.Print("...")
+	}
+	fmt.Println()
+}
+
+func printGroupIconSummary(data []byte) {
+	r := bytes.NewReader(data)
+	var dir ico.ICONDIR
+	if err := binary.Read(r, binary.LittleEndian, &dir); err != nil {
+		fmt.Printf("  icon group: malformed (%s)\n", err)
+		return
+	}
+	entries := make([]rsrc.GRPICONDIRENTRY, dir.Count)
+	if err := binary.Read(r, binary.LittleEndian, &entries); err != nil {
+		fmt.Printf("  icon group: malformed (%s)\n", err)
+		return
+	}
+
+	fmt.Printf("  icon group: %d image(s)\n", len(entries))
+	for _, e := range entries {
+		w, h := int(e.Width), int(e.Height)
+		if w == 0 {
+			w = 256
+		}
+		if h == 0 {
+			h = 256
+		}
+		fmt.Printf("    RT_ICON %d: %dx%d, %d bpp, %d bytes\n", e.ID, w, h, e.BitCount, e.BytesInRes)
+	}
+}
+
+// verBlock is one node of the self-similar block format VS_VERSIONINFO,
+// StringFileInfo/StringTable/String and VarFileInfo/Var all share.
+type verBlock struct {
+	Key       string
+	ValueType uint16
+	Value     []byte
+	Children  []verBlock
+}
+
+func align4(n int) int { return (n + 3) &^ 3 }
+
+// parseVerBlock decodes one version-info block from the front of data and
+// returns it along with the number of bytes (data's wLength) it occupies.
+func parseVerBlock(data []byte) (verBlock, int, error) {
+	if len(data) < 6 {
+		return verBlock{}, 0, fmt.Errorf("version block truncated")
+	}
+	wLength := int(binary.LittleEndian.Uint16(data[0:2]))
+	wValueLength := int(binary.LittleEndian.Uint16(data[2:4]))
+	wType := binary.LittleEndian.Uint16(data[4:6])
+	if wLength > len(data) {
+		return verBlock{}, 0, fmt.Errorf("version block length %d exceeds available %d bytes", wLength, len(data))
+	}
+
+	pos := 6
+	keyStart := pos
+	for pos+1 < wLength && !(data[pos] == 0 && data[pos+1] == 0) {
+		pos += 2
+	}
+	key := decodeUTF16(data[keyStart:pos])
+	pos += 2 // skip the key's NUL terminator
+	pos = align4(pos)
+	if pos > len(data) {
+		pos = len(data) // unterminated key ran past wLength's own bound
+	}
+
+	valueBytes := wValueLength
+	if wType == 1 { // text: wValueLength counts UTF-16 code units, not bytes
+		valueBytes *= 2
+	}
+	if pos+valueBytes > wLength || pos+valueBytes > len(data) {
+		valueBytes = 0 // tolerate malformed/truncated blocks rather than fail
+	}
+	value := data[pos : pos+valueBytes]
+	pos += valueBytes
+	pos = align4(pos)
+
+	var children []verBlock
+	for pos < wLength {
+		if pos+6 > wLength {
+			break
+		}
+		child, n, err := parseVerBlock(data[pos:wLength])
+		if err != nil {
+			break
+		}
+		children = append(children, child)
+		pos += n
+		pos = align4(pos)
+	}
+
+	return verBlock{Key: key, ValueType: wType, Value: value, Children: children}, wLength, nil
+}
+
+func decodeUTF16(b []byte) string {
+	u := make([]uint16, len(b)/2)
+	for i := range u {
+		u[i] = binary.LittleEndian.Uint16(b[i*2 : i*2+2])
+	}
+	return string(utf16.Decode(u))
+}
+
+func printVersionSummary(data []byte) {
+	root, _, err := parseVerBlock(data)
+	if err != nil || root.Key != "VS_VERSION_INFO" {
+		fmt.Println("  version info: malformed VS_VERSIONINFO block")
+		return
+	}
+
+	if len(root.Value) >= 52 {
+		fileVerMS := binary.LittleEndian.Uint32(root.Value[8:12])
+		fileVerLS := binary.LittleEndian.Uint32(root.Value[12:16])
+		prodVerMS := binary.LittleEndian.Uint32(root.Value[16:20])
+		prodVerLS := binary.LittleEndian.Uint32(root.Value[20:24])
+		fmt.Printf("  FileVersion: %d.%d.%d.%d\n", fileVerMS>>16, fileVerMS&0xFFFF, fileVerLS>>16, fileVerLS&0xFFFF)
+		fmt.Printf("  ProductVersion: %d.%d.%d.%d\n", prodVerMS>>16, prodVerMS&0xFFFF, prodVerLS>>16, prodVerLS&0xFFFF)
+	}
+
+	for _, child := range root.Children {
+		switch child.Key {
+		case "StringFileInfo":
+			for _, table := range child.Children {
+				fmt.Printf("  StringFileInfo (%s):\n", table.Key)
+				for _, s := range table.Children {
+					fmt.Printf("    %s: %s\n", s.Key, decodeUTF16(s.Value))
+				}
+			}
+		case "VarFileInfo":
+			for _, v := range child.Children {
+				fmt.Printf("  VarFileInfo %s: % x\n", v.Key, v.Value)
+			}
+		}
+	}
+}
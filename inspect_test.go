@@ -0,0 +1,30 @@
+package main
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+// TestParseVerBlockTruncatedKey reproduces a VS_VERSIONINFO-style block
+// whose key string runs to the very end of the buffer with no UTF-16 NUL
+// terminator, leaving no room for align4(pos) to land inside data even
+// though it's still within wLength. parseVerBlock must report this as a
+// tolerated/malformed block rather than panicking on an out-of-range slice.
+func TestParseVerBlockTruncatedKey(t *testing.T) {
+	data := make([]byte, 7)
+	binary.LittleEndian.PutUint16(data[0:2], 7) // wLength: claims the whole buffer
+	binary.LittleEndian.PutUint16(data[2:4], 0) // wValueLength
+	binary.LittleEndian.PutUint16(data[4:6], 1) // wType: text
+	data[6] = 0x41                              // one stray byte, no NUL terminator
+
+	block, n, err := parseVerBlock(data)
+	if err != nil {
+		t.Fatalf("parseVerBlock: %s", err)
+	}
+	if n != 7 {
+		t.Fatalf("consumed %d bytes, want 7", n)
+	}
+	if len(block.Value) != 0 {
+		t.Fatalf("Value = %v, want empty (malformed block tolerated with no value)", block.Value)
+	}
+}
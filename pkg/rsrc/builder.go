@@ -0,0 +1,210 @@
+// Package rsrc is the importable core of the rsrc tool: build up a set of
+// Windows resources (manifest, icon, version info, or arbitrary raw
+// resources) on a Builder and serialize them to a .syso object file. The
+// rsrc command itself is a thin wrapper around this package.
+package rsrc
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image/png"
+	"io"
+	"io/ioutil"
+
+	"github.com/SentrysAI/rsrc/binutil"
+	"github.com/SentrysAI/rsrc/coff"
+	"github.com/SentrysAI/rsrc/ico"
+	"github.com/josephspurrier/goversioninfo"
+)
+
+// pngMagic is the 8-byte signature at the start of every PNG stream, as
+// used by Vista+ .ico files to store large (typically 256x256) icons that
+// don't fit the classic BMP/DIB entry format.
+const pngMagic = "\x89PNG\r\n\x1a\n"
+
+// pngDimensions reports the width and height of data if it's a PNG stream,
+// decoding only the header rather than the whole image.
+func pngDimensions(data []byte) (width, height int, ok bool) {
+	if len(data) < len(pngMagic) || string(data[:len(pngMagic)]) != pngMagic {
+		return 0, 0, false
+	}
+	cfg, err := png.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return 0, 0, false
+	}
+	return cfg.Width, cfg.Height, true
+}
+
+// iconDirDim clamps a pixel dimension to the width/height field of an
+// ICONDIRENTRY, where the format represents 256 as 0.
+func iconDirDim(px int) uint8 {
+	if px >= 256 {
+		return 0
+	}
+	return uint8(px)
+}
+
+// GRPICONDIR is the RT_GROUP_ICON resource: an ICONDIR header followed by
+// one GRPICONDIRENTRY per RT_ICON this icon group references.
+type GRPICONDIR struct {
+	ico.ICONDIR
+	Entries []GRPICONDIRENTRY
+}
+
+// Size implements binutil.Sizer so a GRPICONDIR can be embedded directly as
+// a resource; it's serialized by recursing into its fields, not copied as
+// raw bytes, so only Size (not Read) is needed.
+func (g GRPICONDIR) Size() int64 {
+	return int64(binary.Size(g.ICONDIR) + binary.Size(g.Entries))
+}
+
+// GRPICONDIRENTRY is one entry of a GRPICONDIR: the common ICONDIRENTRY
+// fields, the size of the image's data, and the RT_ICON resource ID
+// holding it.
+type GRPICONDIRENTRY struct {
+	ico.IconDirEntryCommon
+	BytesInRes uint32
+	ID         uint16
+}
+
+// Builder assembles a set of Windows resources and serializes them into a
+// .syso (COFF) object. The zero value is not usable; use NewBuilder.
+type Builder struct {
+	coff  *coff.Coff
+	newid uint16
+}
+
+// NewBuilder creates a Builder targeting the given architecture (one of
+// "386", "amd64", "arm", "arm64").
+func NewBuilder(arch string) (*Builder, error) {
+	c := coff.NewRSRC()
+	if err := c.Arch(arch); err != nil {
+		return nil, err
+	}
+	return &Builder{coff: c}, nil
+}
+
+// SetArch changes the Builder's target architecture. It may be called at
+// any time before WriteSyso.
+func (b *Builder) SetArch(arch string) error {
+	return b.coff.Arch(arch)
+}
+
+func (b *Builder) nextID() uint16 {
+	b.newid++
+	return b.newid
+}
+
+// AddManifest embeds r as the application's RT_MANIFEST resource.
+func (b *Builder) AddManifest(r io.Reader) error {
+	data, err := sizedFromReader(r)
+	if err != nil {
+		return fmt.Errorf("rsrc: error reading manifest: %s", err)
+	}
+	b.coff.AddResource(coff.RT_MANIFEST, b.nextID(), data)
+	return nil
+}
+
+// AddIcon embeds every image in the .ico file read from r as an RT_ICON
+// resource, grouped under a single RT_GROUP_ICON resource.
+func (b *Builder) AddIcon(r io.Reader) error {
+	buf, err := ioutil.ReadAll(r)
+	if err != nil {
+		return fmt.Errorf("rsrc: error reading icon: %s", err)
+	}
+
+	icons, err := ico.DecodeHeaders(bytes.NewReader(buf))
+	if err != nil {
+		return err
+	}
+	if len(icons) == 0 {
+		return nil
+	}
+
+	group := GRPICONDIR{ICONDIR: ico.ICONDIR{
+		Reserved: 0, // magic num.
+		Type:     1, // magic num.
+		Count:    uint16(len(icons)),
+	}}
+	for _, icon := range icons {
+		id := b.nextID()
+		end := uint64(icon.ImageOffset) + uint64(icon.BytesInRes)
+		if end > uint64(len(buf)) {
+			return fmt.Errorf("rsrc: icon entry %d: image data [%d:%d] exceeds file length %d", id, icon.ImageOffset, end, len(buf))
+		}
+		imgData := buf[icon.ImageOffset:end]
+		r := io.NewSectionReader(bytes.NewReader(buf), int64(icon.ImageOffset), int64(icon.BytesInRes))
+		b.coff.AddResource(coff.RT_ICON, id, r)
+
+		entry := icon.IconDirEntryCommon
+		if w, h, ok := pngDimensions(imgData); ok {
+			// PNG-compressed entries don't carry meaningful BMP/DIB
+			// width/height/planes/bitcount; recompute them from the PNG
+			// header instead of propagating whatever DecodeHeaders saw.
+			entry.Width = iconDirDim(w)
+			entry.Height = iconDirDim(h)
+			entry.Planes = 1
+			entry.BitCount = 32
+		}
+		group.Entries = append(group.Entries, GRPICONDIRENTRY{entry, icon.BytesInRes, id})
+	}
+	b.coff.AddResource(coff.RT_GROUP_ICON, b.nextID(), group)
+	return nil
+}
+
+// AddVersionInfoJSON embeds version info described by a
+// github.com/josephspurrier/goversioninfo config file as the RT_VERSION
+// resource.
+func (b *Builder) AddVersionInfoJSON(jsonBytes []byte) error {
+	vi := &goversioninfo.VersionInfo{}
+	if err := vi.ParseJSON(jsonBytes); err != nil {
+		return fmt.Errorf("rsrc: could not parse version info JSON: %s", err)
+	}
+	vi.Build()
+	vi.Walk()
+
+	b.coff.AddResource(coff.RT_VERSION, 1, goversioninfo.SizedReader{Buffer: &vi.Buffer})
+	return nil
+}
+
+// AddRawResource embeds r at an arbitrary Type/Name/Language location in
+// the resource tree, for resource types the Add* convenience methods above
+// don't cover. name may be a uint16, int or string.
+func (b *Builder) AddRawResource(typeID uint16, name interface{}, lang uint16, r io.Reader) error {
+	data, err := sizedFromReader(r)
+	if err != nil {
+		return fmt.Errorf("rsrc: error reading resource: %s", err)
+	}
+	b.coff.AddResourceEx(typeID, name, lang, data)
+	return nil
+}
+
+// WriteSyso freezes the resource tree and writes the finished .syso (COFF)
+// object to w. It must be called exactly once, after every resource has
+// been added.
+func (b *Builder) WriteSyso(w io.Writer) error {
+	b.coff.Freeze()
+	return b.coff.WriteTo(w)
+}
+
+// WriteRes writes the resource tree to w in the legacy Microsoft .res
+// format instead of a COFF object. Unlike WriteSyso it needs no section
+// layout or relocations, so it doesn't call Freeze.
+func (b *Builder) WriteRes(w io.Writer) error {
+	return b.coff.WriteRes(w)
+}
+
+// sizedFromReader buffers r in full so its contents can be embedded as a
+// binutil.SizedReader, for callers that only have a bare io.Reader rather
+// than a file they could binutil.SizedOpen directly.
+func sizedFromReader(r io.Reader) (binutil.SizedReader, error) {
+	if sr, ok := r.(binutil.SizedReader); ok {
+		return sr, nil
+	}
+	buf, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.NewReader(buf), nil
+}
@@ -0,0 +1,167 @@
+package rsrc
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+
+	"github.com/SentrysAI/rsrc/coff"
+	"github.com/SentrysAI/rsrc/ico"
+)
+
+func encodePNG(t *testing.T, w, h int) []byte {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	img.Set(0, 0, color.RGBA{R: 255, A: 255})
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatalf("png.Encode: %s", err)
+	}
+	return buf.Bytes()
+}
+
+func TestPngDimensions(t *testing.T) {
+	png := encodePNG(t, 64, 32)
+	w, h, ok := pngDimensions(png)
+	if !ok || w != 64 || h != 32 {
+		t.Fatalf("pngDimensions(png) = %d, %d, %v, want 64, 32, true", w, h, ok)
+	}
+
+	if _, _, ok := pngDimensions([]byte("not a png")); ok {
+		t.Fatal("pngDimensions(non-PNG data): got ok=true, want false")
+	}
+}
+
+// buildIcoWithPNG assembles a minimal .ico file holding a single
+// PNG-compressed entry, the way real Vista+ icons store large images.
+func buildIcoWithPNG(t *testing.T, pngData []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, ico.ICONDIR{Reserved: 0, Type: 1, Count: 1})
+	binary.Write(&buf, binary.LittleEndian, ico.IconDirEntry{
+		// Width/Height/BitCount are deliberately wrong here: AddIcon is
+		// expected to recompute them from the PNG header instead.
+		IconDirEntryCommon: ico.IconDirEntryCommon{Width: 0, Height: 0, Planes: 1, BitCount: 0},
+		BytesInRes:         uint32(len(pngData)),
+		ImageOffset:        uint32(6 + 16), // ICONDIR (6) + one ICONDIRENTRY (16)
+	})
+	buf.Write(pngData)
+	return buf.Bytes()
+}
+
+// buildIcoWithBMP assembles a minimal .ico file holding a single classic
+// BMP/DIB entry, whose Width/Height/Planes/BitCount are meaningful as-is
+// and must NOT be touched by AddIcon's PNG fix-up.
+func buildIcoWithBMP(t *testing.T) []byte {
+	t.Helper()
+	imgData := make([]byte, 40) // bare BITMAPINFOHEADER, contents don't matter here
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, ico.ICONDIR{Reserved: 0, Type: 1, Count: 1})
+	binary.Write(&buf, binary.LittleEndian, ico.IconDirEntry{
+		IconDirEntryCommon: ico.IconDirEntryCommon{Width: 24, Height: 24, Planes: 1, BitCount: 24},
+		BytesInRes:         uint32(len(imgData)),
+		ImageOffset:        uint32(6 + 16),
+	})
+	buf.Write(imgData)
+	return buf.Bytes()
+}
+
+// groupIconEntries writes b's resources to a .syso, parses it back, and
+// decodes the RT_GROUP_ICON payload's GRPICONDIRENTRY records, so tests can
+// assert on what AddIcon actually wrote rather than just that it succeeded.
+func groupIconEntries(t *testing.T, b *Builder) []GRPICONDIRENTRY {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := b.WriteSyso(&buf); err != nil {
+		t.Fatalf("WriteSyso: %s", err)
+	}
+
+	obj, err := coff.Parse(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("coff.Parse: %s", err)
+	}
+	resources, err := obj.Resources()
+	if err != nil {
+		t.Fatalf("Resources: %s", err)
+	}
+
+	for _, res := range resources {
+		if res.Type.Int != coff.RT_GROUP_ICON {
+			continue
+		}
+		r := bytes.NewReader(res.Data)
+		var dir ico.ICONDIR
+		if err := binary.Read(r, binary.LittleEndian, &dir); err != nil {
+			t.Fatalf("decode ICONDIR: %s", err)
+		}
+		entries := make([]GRPICONDIRENTRY, dir.Count)
+		if err := binary.Read(r, binary.LittleEndian, &entries); err != nil {
+			t.Fatalf("decode GRPICONDIRENTRY: %s", err)
+		}
+		return entries
+	}
+	t.Fatal("no RT_GROUP_ICON resource found")
+	return nil
+}
+
+func TestAddIconPNGEntry(t *testing.T) {
+	b, err := NewBuilder("amd64")
+	if err != nil {
+		t.Fatalf("NewBuilder: %s", err)
+	}
+
+	pngData := encodePNG(t, 48, 48)
+	if err := b.AddIcon(bytes.NewReader(buildIcoWithPNG(t, pngData))); err != nil {
+		t.Fatalf("AddIcon: %s", err)
+	}
+
+	entries := groupIconEntries(t, b)
+	if len(entries) != 1 {
+		t.Fatalf("got %d GRPICONDIRENTRY, want 1", len(entries))
+	}
+	e := entries[0]
+	if e.Width != 48 || e.Height != 48 || e.Planes != 1 || e.BitCount != 32 {
+		t.Errorf("PNG entry = %+v, want Width=48 Height=48 Planes=1 BitCount=32", e)
+	}
+}
+
+// TestAddIconBMPEntry checks that a classic (non-PNG) entry is passed
+// through unmodified: AddIcon's fix-up only applies to PNG-compressed
+// entries, whose BMP/DIB-shaped header fields don't carry real dimensions.
+func TestAddIconBMPEntry(t *testing.T) {
+	b, err := NewBuilder("amd64")
+	if err != nil {
+		t.Fatalf("NewBuilder: %s", err)
+	}
+
+	if err := b.AddIcon(bytes.NewReader(buildIcoWithBMP(t))); err != nil {
+		t.Fatalf("AddIcon: %s", err)
+	}
+
+	entries := groupIconEntries(t, b)
+	if len(entries) != 1 {
+		t.Fatalf("got %d GRPICONDIRENTRY, want 1", len(entries))
+	}
+	e := entries[0]
+	if e.Width != 24 || e.Height != 24 || e.Planes != 1 || e.BitCount != 24 {
+		t.Errorf("BMP entry = %+v, want Width=24 Height=24 Planes=1 BitCount=24 (untouched)", e)
+	}
+}
+
+func TestAddIconTruncated(t *testing.T) {
+	b, err := NewBuilder("amd64")
+	if err != nil {
+		t.Fatalf("NewBuilder: %s", err)
+	}
+
+	pngData := encodePNG(t, 16, 16)
+	icoBytes := buildIcoWithPNG(t, pngData)
+	truncated := icoBytes[:len(icoBytes)-len(pngData)/2] // chop off half the image data
+
+	if err := b.AddIcon(bytes.NewReader(truncated)); err == nil {
+		t.Fatal("AddIcon(truncated icon): got nil error, want one")
+	}
+}
@@ -1,51 +1,39 @@
 package main
 
 import (
-	"encoding/binary"
 	"flag"
 	"fmt"
 	"io"
 	"io/ioutil"
-	"log"
 	"os"
-	"reflect"
 	"regexp"
 	"strings"
 
 	"github.com/SentrysAI/rsrc/binutil"
 	"github.com/SentrysAI/rsrc/coff"
-	"github.com/SentrysAI/rsrc/ico"
-	"github.com/josephspurrier/goversioninfo"
+	"github.com/SentrysAI/rsrc/pkg/rsrc"
 )
 
-const (
-	RT_ICON       = coff.RT_ICON
-	RT_GROUP_ICON = coff.RT_GROUP_ICON
-	RT_VERSION    = coff.RT_VERSION
-	RT_MANIFEST   = coff.RT_MANIFEST
-)
-
-// on storing icons, see: http://blogs.msdn.com/b/oldnewthing/archive/2012/07/20/10331787.aspx
-type GRPICONDIR struct {
-	ico.ICONDIR
-	Entries []GRPICONDIRENTRY
-}
-
-func (group GRPICONDIR) Size() int64 {
-	return int64(binary.Size(group.ICONDIR) + len(group.Entries)*binary.Size(group.Entries[0]))
-}
-
-type GRPICONDIRENTRY struct {
-	ico.IconDirEntryCommon
-	Id uint16
-}
-
 var usage = `USAGE:
 
 %s [-manifest FILE.exe.manifest] [-ico FILE.ico[,FILE2.ico...]] -o FILE.syso
   Generates a .syso file with specified resources embedded in .rsrc section,
   aimed for consumption by Go linker when building Win32 excecutables.
 
+%s -spec FILE.json -o FILE.syso
+  Generates a .syso file from an arbitrary Type/Name/Language resource tree
+  described in FILE.json, for embedding resource types -manifest/-ico/-version
+  don't cover (RT_BITMAP, RT_DIALOG, RT_STRING, custom types, etc.).
+
+%s -inspect FILE.syso
+  Parses an existing .syso file's .rsrc section and prints its resource
+  tree, with decoded summaries for RT_MANIFEST, RT_VERSION and
+  RT_GROUP_ICON.
+
+-format=res can be added to any of the resource-embedding modes above to
+emit the legacy Microsoft .res format instead of .syso; it's auto-detected
+from -o's extension, so it rarely needs to be given explicitly.
+
 The generated *.syso files should get automatically recognized by 'go build'
 command and linked into an executable/library, as long as there are any *.go
 files in the same directory.
@@ -54,27 +42,38 @@ OPTIONS:
 `
 
 func main() {
-	//TODO: allow in options advanced specification of multiple resources, as a tree (json?)
 	//FIXME: verify that data file size doesn't exceed uint32 max value
-	var fnamein, fnameico, fnameversion, fnamedata, fnameout, arch string
+	var fnamein, fnameico, fnameversion, fnamedata, fnamespec, fnameinspect, fnameout, arch, format string
 	flags := flag.NewFlagSet("", flag.ContinueOnError)
 	flags.StringVar(&fnamein, "manifest", "", "path to a Windows manifest file to embed")
 	flags.StringVar(&fnameico, "ico", "", "comma-separated list of paths to .ico files to embed")
 	flags.StringVar(&fnameversion, "version", "", "path to a JSON file for version info")
 	flags.StringVar(&fnamedata, "data", "", "path to raw data file to embed [WARNING: useless for Go 1.4+]")
+	flags.StringVar(&fnamespec, "spec", "", "path to a JSON file describing an arbitrary resource tree to embed")
+	flags.StringVar(&fnameinspect, "inspect", "", "path to an existing .syso file whose resource tree should be printed")
 	flags.StringVar(&fnameout, "o", "rsrc.syso", "name of output COFF (.res or .syso) file")
-	flags.StringVar(&arch, "arch", "386", "architecture of output file - one of: 386, [EXPERIMENTAL: amd64]")
+	flags.StringVar(&arch, "arch", "386", "architecture of output file - one of: 386, amd64, arm, arm64")
+	flags.StringVar(&format, "format", "", "output format - one of: res, syso (default: auto-detected from -o's extension)")
 	_ = flags.Parse(os.Args[1:])
-	if fnameout == "" || (fnamein == "" && fnamedata == "" && fnameico == "" && fnameversion == "") {
-		fmt.Fprintf(os.Stderr, usage, os.Args[0])
+	if fnameinspect == "" && (fnameout == "" || (fnamein == "" && fnamedata == "" && fnameico == "" && fnameversion == "" && fnamespec == "")) {
+		fmt.Fprintf(os.Stderr, usage, os.Args[0], os.Args[0], os.Args[0])
 		flags.PrintDefaults()
 		os.Exit(1)
 	}
 
-	var err error
+	outFormat, err := resolveFormat(format, fnameout)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
 	switch {
+	case fnameinspect != "":
+		err = runInspect(fnameinspect)
+	case fnamespec != "":
+		err = runSpec(fnamespec, fnameout, arch, outFormat)
 	case fnamein != "" || fnameico != "" || fnameversion != "":
-		err = run(fnamein, fnameico, fnameversion, fnameout, arch)
+		err = run(fnamein, fnameico, fnameversion, fnameout, arch, outFormat)
 	case fnamedata != "":
 		err = rundata(fnamedata, fnameout, arch)
 	}
@@ -111,7 +110,7 @@ func rundata(fnamedata, fnameout, arch string) error {
 	coff.AddData("_brsrc_"+symname, dat)
 	coff.AddData("_ersrc_"+symname, io.NewSectionReader(strings.NewReader("\000\000"), 0, 2)) // TODO: why? copied from as-generated
 	coff.Freeze()
-	err = write(coff, fnameout)
+	err = write(coff, fnameout, "syso")
 	if err != nil {
 		return err
 	}
@@ -130,148 +129,102 @@ void ·get_NAME(Slice a) {
 	return nil
 }
 
-func run(fnamein, fnameico, fnameversion, fnameout, arch string) error {
-	fmt.Println("fnameversion: ", fnameversion)
-	newid := make(chan uint16)
-	go func() {
-		for i := uint16(1); ; i++ {
-			newid <- i
+// resolveFormat decides which output format to use: explicit, if given, or
+// else whatever -o's extension implies ('.res' for .res, everything else for
+// .syso, matching the tool's long-standing default).
+func resolveFormat(explicit, fnameout string) (string, error) {
+	switch explicit {
+	case "":
+		if strings.HasSuffix(fnameout, ".res") {
+			return "res", nil
 		}
-	}()
+		return "syso", nil
+	case "res", "syso":
+		return explicit, nil
+	default:
+		return "", fmt.Errorf("Invalid -format '%s': must be 'res' or 'syso'", explicit)
+	}
+}
 
-	coff := coff.NewRSRC()
-	err := coff.Arch(arch)
+func run(fnamein, fnameico, fnameversion, fnameout, arch, format string) error {
+	b, err := rsrc.NewBuilder(arch)
 	if err != nil {
 		return err
 	}
 
 	if fnamein != "" {
-		manifest, err := binutil.SizedOpen(fnamein)
+		manifest, err := os.Open(fnamein)
 		if err != nil {
 			return fmt.Errorf("Error opening manifest file '%s': %s", fnamein, err)
 		}
 		defer manifest.Close()
 
-		id := <-newid
-		coff.AddResource(RT_MANIFEST, id, manifest)
-		fmt.Println("Manifest ID: ", id)
+		if err := b.AddManifest(manifest); err != nil {
+			return fmt.Errorf("Error adding manifest file '%s': %s", fnamein, err)
+		}
 	}
 	if fnameico != "" {
 		for _, fnameicosingle := range strings.Split(fnameico, ",") {
-			err := addicon(coff, fnameicosingle, newid)
-			if err != nil {
+			if err := addicon(b, fnameicosingle); err != nil {
 				return err
 			}
 		}
 	}
 
 	if fnameversion != "" {
-		err := addVersion(coff, fnameversion)
+		jsonBytes, err := ioutil.ReadFile(fnameversion)
 		if err != nil {
-			return err
+			return fmt.Errorf("Error reading version file '%s': %s", fnameversion, err)
+		}
+		if err := b.AddVersionInfoJSON(jsonBytes); err != nil {
+			return fmt.Errorf("Error adding version file '%s': %s", fnameversion, err)
 		}
 	}
 
-	coff.Freeze()
-
-	return write(coff, fnameout)
-}
-
-func addicon(coff *coff.Coff, fname string, newid <-chan uint16) error {
-	f, err := os.Open(fname)
+	out, err := os.Create(fnameout)
 	if err != nil {
 		return err
 	}
-	//defer f.Close() don't defer, files will be closed by OS when app closes
+	defer out.Close()
 
-	icons, err := ico.DecodeHeaders(f)
-	if err != nil {
-		return err
+	if format == "res" {
+		err = b.WriteRes(out)
+	} else {
+		err = b.WriteSyso(out)
 	}
-
-	if len(icons) > 0 {
-		// RT_ICONs
-		group := GRPICONDIR{ICONDIR: ico.ICONDIR{
-			Reserved: 0, // magic num.
-			Type:     1, // magic num.
-			Count:    uint16(len(icons)),
-		}}
-		for _, icon := range icons {
-			id := <-newid
-			r := io.NewSectionReader(f, int64(icon.ImageOffset), int64(icon.BytesInRes))
-			coff.AddResource(RT_ICON, id, r)
-			group.Entries = append(group.Entries, GRPICONDIRENTRY{icon.IconDirEntryCommon, id})
-		}
-		id := <-newid
-		coff.AddResource(RT_GROUP_ICON, id, group)
-		fmt.Println("Icon ", fname, " ID: ", id)
+	if err != nil {
+		return fmt.Errorf("Error writing output file: %s", err)
 	}
-
 	return nil
 }
 
-func addVersion(coff *coff.Coff, fname string) error {
-	// Open the config file
-	input, err := os.Open(fname)
+func addicon(b *rsrc.Builder, fname string) error {
+	f, err := os.Open(fname)
 	if err != nil {
-		log.Printf("Cannot open %q: %v", input, err)
-		return err
+		return fmt.Errorf("Error opening icon file '%s': %s", fname, err)
 	}
+	defer f.Close()
 
-	// Read the config file
-	jsonBytes, err := ioutil.ReadAll(input)
-	input.Close()
-	if err != nil {
-		log.Printf("Error reading %q: %v", input, err)
-		return err
+	if err := b.AddIcon(f); err != nil {
+		return fmt.Errorf("Error adding icon file '%s': %s", fname, err)
 	}
-
-	// Create a new container
-	vi := &goversioninfo.VersionInfo{}
-
-	// Parse the config
-	if err := vi.ParseJSON(jsonBytes); err != nil {
-		log.Printf("Could not parse the .json file: %v", err)
-		return err
-	}
-
-	// Fill the structures with config data
-	vi.Build()
-
-	// Write the data to a buffer
-	vi.Walk()
-
-	// ID 16 is for Version Information
-	coff.AddResource(RT_VERSION, 1, goversioninfo.SizedReader{&vi.Buffer})
-	fmt.Println("Version ", fname, "ID:  1")
 	return nil
 }
 
-func write(coff *coff.Coff, fnameout string) error {
+func write(c *coff.Coff, fnameout, format string) error {
 	out, err := os.Create(fnameout)
 	if err != nil {
 		return err
 	}
 	defer out.Close()
-	w := binutil.Writer{W: out}
 
-	// write the resulting file to disk
-	binutil.Walk(coff, func(v reflect.Value, path string) error {
-		if binutil.Plain(v.Kind()) {
-			w.WriteLE(v.Interface())
-			return nil
-		}
-		vv, ok := v.Interface().(binutil.SizedReader)
-		if ok {
-			w.WriteFromSized(vv)
-			return binutil.WALK_SKIP
-		}
-		return nil
-	})
-
-	if w.Err != nil {
-		return fmt.Errorf("Error writing output file: %s", w.Err)
+	if format == "res" {
+		err = c.WriteRes(out)
+	} else {
+		err = c.WriteTo(out)
+	}
+	if err != nil {
+		return fmt.Errorf("Error writing output file: %s", err)
 	}
-
 	return nil
 }
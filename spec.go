@@ -0,0 +1,135 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/SentrysAI/rsrc/binutil"
+	"github.com/SentrysAI/rsrc/coff"
+)
+
+// specResource is one entry of a -spec JSON file: it places a single file's
+// contents at one Type/Name/Language leaf of the resource tree.
+type specResource struct {
+	Type interface{} `json:"type"` // an "RT_*" name, or a numeric type ID
+	Name interface{} `json:"name"` // a numeric ID, or a string name
+	Lang *uint16     `json:"lang"` // omitted defaults to coff.LangDefault (en-US); a pointer so an explicit 0 (LANG_NEUTRAL) isn't mistaken for "omitted"
+	File string      `json:"file"`
+}
+
+// resourceSpec is the root of a -spec JSON file.
+type resourceSpec struct {
+	Resources []specResource `json:"resources"`
+}
+
+// rtByName maps the "RT_*" names accepted in a spec's "type" field to their
+// numeric resource type IDs.
+var rtByName = map[string]uint16{
+	"RT_CURSOR":       coff.RT_CURSOR,
+	"RT_BITMAP":       coff.RT_BITMAP,
+	"RT_ICON":         coff.RT_ICON,
+	"RT_MENU":         coff.RT_MENU,
+	"RT_DIALOG":       coff.RT_DIALOG,
+	"RT_STRING":       coff.RT_STRING,
+	"RT_FONTDIR":      coff.RT_FONTDIR,
+	"RT_FONT":         coff.RT_FONT,
+	"RT_ACCELERATOR":  coff.RT_ACCELERATOR,
+	"RT_RCDATA":       coff.RT_RCDATA,
+	"RT_MESSAGETABLE": coff.RT_MESSAGETABLE,
+	"RT_GROUP_CURSOR": coff.RT_GROUP_CURSOR,
+	"RT_GROUP_ICON":   coff.RT_GROUP_ICON,
+	"RT_VERSION":      coff.RT_VERSION,
+	"RT_DLGINCLUDE":   coff.RT_DLGINCLUDE,
+	"RT_PLUGPLAY":     coff.RT_PLUGPLAY,
+	"RT_VXD":          coff.RT_VXD,
+	"RT_ANICURSOR":    coff.RT_ANICURSOR,
+	"RT_ANIICON":      coff.RT_ANIICON,
+	"RT_HTML":         coff.RT_HTML,
+	"RT_MANIFEST":     coff.RT_MANIFEST,
+}
+
+// resourceType resolves a spec resource's "type" field, which may be either
+// one of the well-known "RT_*" names or a bare numeric type ID (for custom
+// resource types the list above doesn't name).
+func resourceType(v interface{}) (uint16, error) {
+	switch t := v.(type) {
+	case string:
+		id, ok := rtByName[t]
+		if !ok {
+			return 0, fmt.Errorf(`unknown resource type "%s"`, t)
+		}
+		return id, nil
+	case float64:
+		return uint16(t), nil
+	default:
+		return 0, fmt.Errorf("\"type\" must be a string or number, got %T", v)
+	}
+}
+
+// resourceName resolves a spec resource's "name" field into whatever
+// coff.AddResourceEx expects: a uint16 numeric ID or a string.
+func resourceName(v interface{}) (interface{}, error) {
+	switch t := v.(type) {
+	case string:
+		return t, nil
+	case float64:
+		return uint16(t), nil
+	default:
+		return nil, fmt.Errorf("\"name\" must be a string or number, got %T", v)
+	}
+}
+
+// runSpec implements -spec: it loads an arbitrary Type/Name/Language
+// resource tree from a JSON file, streaming each leaf's file in via
+// binutil.SizedOpen, so resource types -manifest/-ico/-version don't cover
+// can still be embedded.
+func runSpec(fnamespec, fnameout, arch, format string) error {
+	specBytes, err := ioutil.ReadFile(fnamespec)
+	if err != nil {
+		return fmt.Errorf("Error reading spec file '%s': %s", fnamespec, err)
+	}
+
+	var spec resourceSpec
+	if err := json.Unmarshal(specBytes, &spec); err != nil {
+		return fmt.Errorf("Error parsing spec file '%s': %s", fnamespec, err)
+	}
+
+	coffObj := coff.NewRSRC()
+	if err := coffObj.Arch(arch); err != nil {
+		return err
+	}
+
+	for i, res := range spec.Resources {
+		typeID, err := resourceType(res.Type)
+		if err != nil {
+			return fmt.Errorf("spec resource #%d: %s", i, err)
+		}
+		name, err := resourceName(res.Name)
+		if err != nil {
+			return fmt.Errorf("spec resource #%d: %s", i, err)
+		}
+		if res.File == "" {
+			return fmt.Errorf(`spec resource #%d: "file" is required`, i)
+		}
+
+		data, err := binutil.SizedOpen(res.File)
+		if err != nil {
+			return fmt.Errorf("spec resource #%d: error opening '%s': %s", i, res.File, err)
+		}
+		defer data.Close()
+
+		lang := uint16(coff.LangDefault)
+		if res.Lang != nil {
+			lang = *res.Lang
+		}
+		coffObj.AddResourceEx(typeID, name, lang, data)
+	}
+
+	// WriteRes reads the tree's logical (pre-Freeze) form directly; only the
+	// .syso path needs Freeze to lay out sections and relocations.
+	if format != "res" {
+		coffObj.Freeze()
+	}
+	return write(coffObj, fnameout, format)
+}
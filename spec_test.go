@@ -0,0 +1,63 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/SentrysAI/rsrc/coff"
+)
+
+// TestRunSpecExplicitLangZero checks that an explicit "lang": 0
+// (LANG_NEUTRAL) in a spec file survives into the resource tree rather
+// than being silently rewritten to coff.LangDefault, which only omitting
+// "lang" entirely should do.
+func TestRunSpecExplicitLangZero(t *testing.T) {
+	dir := t.TempDir()
+
+	dataFile := filepath.Join(dir, "blob.bin")
+	if err := os.WriteFile(dataFile, []byte("payload"), 0644); err != nil {
+		t.Fatalf("WriteFile: %s", err)
+	}
+
+	specFile := filepath.Join(dir, "spec.json")
+	specJSON := `{"resources": [
+		{"type": "RT_RCDATA", "name": 1, "lang": 0, "file": "` + dataFile + `"},
+		{"type": "RT_RCDATA", "name": 2, "file": "` + dataFile + `"}
+	]}`
+	if err := os.WriteFile(specFile, []byte(specJSON), 0644); err != nil {
+		t.Fatalf("WriteFile: %s", err)
+	}
+
+	outFile := filepath.Join(dir, "out.syso")
+	if err := runSpec(specFile, outFile, "amd64", "syso"); err != nil {
+		t.Fatalf("runSpec: %s", err)
+	}
+
+	f, err := os.Open(outFile)
+	if err != nil {
+		t.Fatalf("Open: %s", err)
+	}
+	defer f.Close()
+
+	obj, err := coff.Parse(f)
+	if err != nil {
+		t.Fatalf("Parse: %s", err)
+	}
+	resources, err := obj.Resources()
+	if err != nil {
+		t.Fatalf("Resources: %s", err)
+	}
+
+	langByName := map[uint16]uint16{}
+	for _, res := range resources {
+		langByName[res.Name.Int] = res.Lang.Int
+	}
+
+	if got := langByName[1]; got != 0 {
+		t.Errorf(`explicit "lang": 0 resource: Lang = 0x%04X, want 0 (LANG_NEUTRAL)`, got)
+	}
+	if got := langByName[2]; got != coff.LangDefault {
+		t.Errorf(`omitted "lang" resource: Lang = 0x%04X, want 0x%04X (coff.LangDefault)`, got, coff.LangDefault)
+	}
+}